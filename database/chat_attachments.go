@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// EnsureChatAttachments adds the message kind/edit/delete columns to
+// messages and creates the attachments table, if they don't already exist.
+func EnsureChatAttachments() error {
+	if err := ensureMessagesColumn("kind", "TEXT NOT NULL DEFAULT 'text'"); err != nil {
+		return err
+	}
+	if err := ensureMessagesColumn("edited_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := ensureMessagesColumn("deleted_at", "DATETIME"); err != nil {
+		return err
+	}
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER,
+		uploader_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		mime TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		width INTEGER,
+		height INTEGER,
+		thumb_url TEXT
+	)`)
+	return err
+}
+
+// ensureMessagesColumn adds a column to messages if it isn't already there.
+// SQLite's ALTER TABLE ADD COLUMN has no portable IF NOT EXISTS form, so we
+// check PRAGMA table_info ourselves to keep this safe to call on startup.
+func ensureMessagesColumn(name, definition string) error {
+	rows, err := DB.Query(`PRAGMA table_info(messages)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var colName, colType string
+		var dfltValue sql.NullString
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if colName == name {
+			return nil
+		}
+	}
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE messages ADD COLUMN %s %s", name, definition))
+	return err
+}
@@ -0,0 +1,15 @@
+package database
+
+// EnsureChatEvents creates the chat_events table backing the eventbus's
+// at-least-once delivery log, if it doesn't already exist.
+func EnsureChatEvents() error {
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS chat_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		delivered_at DATETIME
+	)`)
+	return err
+}
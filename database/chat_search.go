@@ -0,0 +1,39 @@
+package database
+
+// EnsureMessagesFTS creates the messages_fts external-content virtual table and
+// the triggers that keep it in sync with the messages table. It's a no-op
+// if they already exist, so it's safe to call on every startup.
+func EnsureMessagesFTS() error {
+	stmts := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+			content,
+			content='messages',
+			content_rowid='id'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE ON messages BEGIN
+			INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+			INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+		END`,
+	}
+	for _, stmt := range stmts {
+		if _, err := DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildFTS backfills messages_fts from the current contents of messages.
+// Call it once after EnsureMessagesFTS to index pre-existing rows, and
+// again any time the index needs to be rebuilt from scratch (e.g. from an
+// admin endpoint).
+func RebuildFTS() error {
+	_, err := DB.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`)
+	return err
+}
@@ -0,0 +1,172 @@
+// Package eventbus durably logs chat events to the chat_events table and
+// attempts live delivery to whatever transport is currently listening,
+// turning chat notifications from fire-and-forget into at-least-once
+// delivery: an event that misses every open connection survives a
+// reconnect and gets replayed via Since.
+package eventbus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/xashathebest/clovia/database"
+	"github.com/xashathebest/clovia/models"
+)
+
+// defaultRetention is how long a delivered event is kept around before
+// pruneDelivered removes it, long enough to cover any reasonable
+// reconnect window.
+const defaultRetention = 7 * 24 * time.Hour
+
+func init() {
+	if err := database.EnsureChatEvents(); err != nil {
+		log.Printf("eventbus: failed to ensure chat_events table: %v", err)
+	}
+	StartPruner(defaultRetention)
+}
+
+// DeliverFunc attempts to push an event to whatever live transports a user
+// currently has open, returning whether the push plausibly reached a client.
+// Registered by the handlers package at init time to avoid an import cycle
+// back into its live-transport hub.
+type DeliverFunc func(userID models.UserID, eventID int64, eventType string, data interface{}) bool
+
+var deliver DeliverFunc
+
+// SetDeliverFunc registers the live-delivery callback.
+func SetDeliverFunc(fn DeliverFunc) { deliver = fn }
+
+// Event is a row of the durable chat_events log.
+type Event struct {
+	ID          int64
+	UserID      models.UserID
+	Type        string
+	Payload     json.RawMessage
+	CreatedAt   time.Time
+	DeliveredAt *time.Time
+}
+
+// Publish persists an event for userID and attempts live delivery. The
+// returned ID is the chat_events row id, usable by SSE clients as a
+// Last-Event-ID.
+func Publish(userID models.UserID, eventType string, data interface{}) (int64, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO chat_events (user_id, type, payload, created_at) VALUES (?, ?, ?, ?)`,
+		userID, eventType, string(payload), time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+
+	if deliver != nil && deliver(userID, id, eventType, data) {
+		if err := MarkDelivered(userID, id); err != nil {
+			log.Printf("eventbus: failed to mark event %d delivered: %v", id, err)
+		}
+	}
+	return id, nil
+}
+
+// MarkDelivered sets an event's delivered_at. It's called when a client
+// acks the event, and also by Publish and retryUndelivered when live
+// delivery reports success and by Stream after a backlog frame is flushed.
+// It's scoped to userID so one user can't mark another user's event
+// delivered by guessing chat_events ids, which would otherwise cause
+// pruneDelivered to purge it and retryUndelivered to give up on it.
+func MarkDelivered(userID models.UserID, eventID int64) error {
+	_, err := database.DB.Exec(`UPDATE chat_events SET delivered_at = ? WHERE id = ? AND user_id = ?`, time.Now(), eventID, userID)
+	return err
+}
+
+// Since returns every event for userID with id > afterID, in order, so a
+// reconnecting client can replay whatever it missed.
+func Since(userID models.UserID, afterID int64) ([]Event, error) {
+	rows, err := database.DB.Query(
+		`SELECT id, user_id, type, payload, created_at, delivered_at FROM chat_events
+		 WHERE user_id = ? AND id > ? ORDER BY id ASC`,
+		userID, afterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var evt Event
+		var payload string
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&evt.ID, &evt.UserID, &evt.Type, &payload, &evt.CreatedAt, &deliveredAt); err != nil {
+			continue
+		}
+		evt.Payload = json.RawMessage(payload)
+		if deliveredAt.Valid {
+			evt.DeliveredAt = &deliveredAt.Time
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+// StartPruner launches a background goroutine that deletes delivered events
+// older than retention and retries live delivery for events not yet marked
+// delivered. It runs until the process exits.
+func StartPruner(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			pruneDelivered(retention)
+			retryUndelivered()
+		}
+	}()
+}
+
+func pruneDelivered(retention time.Duration) {
+	cutoff := time.Now().Add(-retention)
+	if _, err := database.DB.Exec(`DELETE FROM chat_events WHERE delivered_at IS NOT NULL AND delivered_at < ?`, cutoff); err != nil {
+		log.Printf("eventbus: prune failed: %v", err)
+	}
+}
+
+func retryUndelivered() {
+	if deliver == nil {
+		return
+	}
+	rows, err := database.DB.Query(`SELECT id, user_id, type, payload FROM chat_events WHERE delivered_at IS NULL ORDER BY id ASC LIMIT 500`)
+	if err != nil {
+		log.Printf("eventbus: retry query failed: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	type pending struct {
+		id      int64
+		userID  models.UserID
+		evtType string
+		payload string
+	}
+	var items []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.evtType, &p.payload); err == nil {
+			items = append(items, p)
+		}
+	}
+
+	for _, p := range items {
+		var data interface{}
+		if err := json.Unmarshal([]byte(p.payload), &data); err != nil {
+			continue
+		}
+		if deliver(p.userID, p.id, p.evtType, data) {
+			_ = MarkDelivered(p.userID, p.id)
+		}
+	}
+}
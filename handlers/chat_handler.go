@@ -2,80 +2,284 @@ package handlers
 
 import (
 	"bufio"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"log"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/xashathebest/clovia/database"
+	"github.com/xashathebest/clovia/eventbus"
 	"github.com/xashathebest/clovia/middleware"
 	"github.com/xashathebest/clovia/models"
 )
 
+func init() {
+	eventbus.SetDeliverFunc(deliverLive)
+	if err := database.EnsureChatAttachments(); err != nil {
+		log.Printf("chat: failed to ensure attachments schema: %v", err)
+	}
+	if err := database.EnsureMessagesFTS(); err != nil {
+		log.Printf("chat: failed to ensure messages_fts schema: %v", err)
+	} else if err := database.RebuildFTS(); err != nil {
+		log.Printf("chat: failed to backfill messages_fts: %v", err)
+	}
+}
+
 type ChatHandler struct{}
 
 func NewChatHandler() *ChatHandler { return &ChatHandler{} }
 
-// SSE subscribers map: userID -> list of channels
-var userStreams = struct {
-	sync.RWMutex
-	m map[int][]chan []byte
-}{m: make(map[int][]chan []byte)}
+const (
+	presenceOnline  = "online"
+	presenceAway    = "away"
+	presenceOffline = "offline"
+
+	presenceHeartbeatWindow = 45 * time.Second
+
+	// messageEditWindow bounds how long after sending a message its sender
+	// may still edit it.
+	messageEditWindow = 15 * time.Minute
+
+	// tombstoneContent replaces the content of a soft-deleted message.
+	tombstoneContent = "This message was deleted"
+)
+
+// messageKind distinguishes plain chat text from richer payloads
+// (attachments, inline offers, system notices) so GetMessages and clients
+// know how to render a row.
+type messageKind string
+
+const (
+	messageKindText   messageKind = "text"
+	messageKindImage  messageKind = "image"
+	messageKindFile   messageKind = "file"
+	messageKindOffer  messageKind = "offer"
+	messageKindSystem messageKind = "system"
+)
+
+func (k messageKind) valid() bool {
+	switch k {
+	case messageKindText, messageKindImage, messageKindFile, messageKindOffer, messageKindSystem:
+		return true
+	default:
+		return false
+	}
+}
+
+// chatAttachment is an uploaded file bound to a message. Attachments are
+// created unbound (no message_id) by UploadAttachment, then claimed by
+// SendMessage once the sender actually posts them.
+type chatAttachment struct {
+	ID       int64  `json:"id"`
+	URL      string `json:"url"`
+	Mime     string `json:"mime"`
+	Size     int64  `json:"size"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	ThumbURL string `json:"thumb_url,omitempty"`
+}
+
+// idMap is a concurrency-safe map keyed by a typed ~int64 id. Using it for
+// the SSE/WS subscriber registries means passing, say, a ConversationID
+// where a UserID key is expected is a compile error rather than a runtime
+// mix-up.
+type idMap[K ~int64, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+}
+
+func newIDMap[K ~int64, V any]() *idMap[K, V] {
+	return &idMap[K, V]{m: make(map[K]V)}
+}
+
+func (im *idMap[K, V]) get(k K) (V, bool) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+	v, ok := im.m[k]
+	return v, ok
+}
+
+func (im *idMap[K, V]) set(k K, v V) {
+	im.mu.Lock()
+	im.m[k] = v
+	im.mu.Unlock()
+}
+
+// update reads the current value for k (the zero value if absent), passes
+// it through fn, and stores the result. It's the read-modify-write building
+// block addSSE/removeSSE/addWS/removeWS use to mutate a per-user slice.
+func (im *idMap[K, V]) update(k K, fn func(V) V) {
+	im.mu.Lock()
+	im.m[k] = fn(im.m[k])
+	im.mu.Unlock()
+}
+
+// wsConn wraps a WS connection with its per-conversation subscriptions so
+// fan-out can filter frames to whatever the client is actively viewing.
+type wsConn struct {
+	conn          *websocket.Conn
+	writeMu       sync.Mutex
+	mu            sync.RWMutex
+	subscriptions map[models.ConversationID]bool
+}
+
+func (wc *wsConn) subscribed(conversationID models.ConversationID) bool {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+	return wc.subscriptions[conversationID]
+}
+
+func (wc *wsConn) writeRaw(payload []byte) error {
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+	return wc.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+// streamFrame carries an SSE payload plus the chat_events row id it
+// originated from, so the writer can emit an "id:" line for Last-Event-ID.
+type streamFrame struct {
+	id      int64
+	payload []byte
+}
+
+// chatHub centralizes every live transport (SSE channels and WS connections)
+// plus presence state, so publishToUser has a single dispatch path.
+var chatHub = &hub{
+	sse:      newIDMap[models.UserID, []chan streamFrame](),
+	ws:       newIDMap[models.UserID, []*wsConn](),
+	presence: newIDMap[models.UserID, string](),
+}
+
+type hub struct {
+	sse      *idMap[models.UserID, []chan streamFrame]
+	ws       *idMap[models.UserID, []*wsConn]
+	presence *idMap[models.UserID, string]
+}
+
+func (hb *hub) addSSE(userID models.UserID, ch chan streamFrame) {
+	hb.sse.update(userID, func(chans []chan streamFrame) []chan streamFrame {
+		return append(chans, ch)
+	})
+}
+
+func (hb *hub) removeSSE(userID models.UserID, ch chan streamFrame) {
+	hb.sse.update(userID, func(chans []chan streamFrame) []chan streamFrame {
+		for i, s := range chans {
+			if s == ch {
+				return append(chans[:i], chans[i+1:]...)
+			}
+		}
+		return chans
+	})
+}
+
+func (hb *hub) addWS(userID models.UserID, wc *wsConn) {
+	hb.ws.update(userID, func(conns []*wsConn) []*wsConn {
+		return append(conns, wc)
+	})
+	hb.presence.set(userID, presenceOnline)
+}
+
+func (hb *hub) removeWS(userID models.UserID, wc *wsConn) {
+	var remaining []*wsConn
+	hb.ws.update(userID, func(conns []*wsConn) []*wsConn {
+		for i, c := range conns {
+			if c == wc {
+				conns = append(conns[:i], conns[i+1:]...)
+				break
+			}
+		}
+		remaining = conns
+		return conns
+	})
+	if len(remaining) == 0 {
+		hb.presence.set(userID, presenceOffline)
+	}
+}
+
+func (hb *hub) setPresence(userID models.UserID, state string) {
+	hb.presence.set(userID, state)
+}
+
+func (hb *hub) presenceOf(userID models.UserID) string {
+	if state, ok := hb.presence.get(userID); ok {
+		return state
+	}
+	return presenceOffline
+}
 
 type sseEvent struct {
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
 }
 
-// Stream provides an SSE stream for the authenticated user
+// resolveStreamUser authenticates a streaming connection, falling back to a
+// query-string token for clients (EventSource, some WS libs) that can't set
+// an Authorization header.
+func resolveStreamUser(c *fiber.Ctx) (models.UserID, bool) {
+	if userID, ok := middleware.GetUserIDFromContext(c); ok {
+		return userID, true
+	}
+	token := c.Query("token", "")
+	if token == "" {
+		return 0, false
+	}
+	c.Request().Header.Set("Authorization", "Bearer "+token)
+	if err := middleware.AuthMiddleware()(c); err != nil {
+		return 0, false
+	}
+	return middleware.GetUserIDFromContext(c)
+}
+
+// Stream provides an SSE stream for the authenticated user. Clients that
+// reconnect with a Last-Event-ID header (or "last_event_id" query param, for
+// EventSource polyfills that can't set headers) replay whatever events they
+// missed, in order, before the stream goes live.
 func (h *ChatHandler) Stream(c *fiber.Ctx) error {
-	userID, ok := middleware.GetUserIDFromContext(c)
+	userID, ok := resolveStreamUser(c)
 	if !ok {
-		// Allow token via query for SSE clients that can't set headers
-		token := c.Query("token", "")
-		if token == "" {
-			return fiber.ErrUnauthorized
-		}
-		c.Request().Header.Set("Authorization", "Bearer "+token)
-		if err := middleware.AuthMiddleware()(c); err != nil {
-			return fiber.ErrUnauthorized
-		}
-		userID, ok = middleware.GetUserIDFromContext(c)
-		if !ok {
-			return fiber.ErrUnauthorized
-		}
+		return fiber.ErrUnauthorized
 	}
 	c.Set("Content-Type", "text/event-stream")
 	c.Set("Cache-Control", "no-cache")
 	c.Set("Connection", "keep-alive")
 
-	msgCh := make(chan []byte, 32)
-	// register
-	userStreams.Lock()
-	userStreams.m[userID] = append(userStreams.m[userID], msgCh)
-	userStreams.Unlock()
+	msgCh := make(chan streamFrame, 32)
+	chatHub.addSSE(userID, msgCh)
 
-	// cleanup on finish
 	defer func() {
-		userStreams.Lock()
-		subs := userStreams.m[userID]
-		for i, ch := range subs {
-			if ch == msgCh {
-				userStreams.m[userID] = append(subs[:i], subs[i+1:]...)
-				break
-			}
-		}
-		userStreams.Unlock()
+		chatHub.removeSSE(userID, msgCh)
 		close(msgCh)
 	}()
 
+	lastEventID := lastEventIDFromRequest(c)
+	backlog, err := eventbus.Since(userID, lastEventID)
+	if err != nil {
+		log.Printf("chat: failed to load event backlog for user %d: %v", userID, err)
+	}
+
 	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for _, evt := range backlog {
+			writeSSEFrame(w, streamFrame{id: evt.ID, payload: evt.Payload})
+			if err := w.Flush(); err != nil {
+				// Connection dropped mid-backlog: leave the remaining (and
+				// this) events undelivered so a reconnect replays them.
+				return
+			}
+			if err := eventbus.MarkDelivered(userID, evt.ID); err != nil {
+				log.Printf("chat: failed to mark event %d delivered: %v", evt.ID, err)
+			}
+		}
 		for {
-			if b, ok := <-msgCh; ok {
-				w.WriteString("data: ")
-				w.Write(b)
-				w.WriteString("\n\n")
+			if frame, ok := <-msgCh; ok {
+				writeSSEFrame(w, frame)
 				w.Flush()
 			} else {
 				break
@@ -85,31 +289,249 @@ func (h *ChatHandler) Stream(c *fiber.Ctx) error {
 	return nil
 }
 
-// helper to publish an event to a user
-func publishToUser(userID int, evt sseEvent) {
-	userStreams.RLock()
-	subs := userStreams.m[userID]
-	userStreams.RUnlock()
-	if len(subs) == 0 {
-		return
+func lastEventIDFromRequest(c *fiber.Ctx) int64 {
+	raw := c.Get("Last-Event-ID", "")
+	if raw == "" {
+		raw = c.Query("last_event_id", "")
+	}
+	id, _ := strconv.ParseInt(raw, 10, 64)
+	return id
+}
+
+func writeSSEFrame(w *bufio.Writer, frame streamFrame) {
+	if frame.id > 0 {
+		fmt.Fprintf(w, "id: %d\n", frame.id)
 	}
-	payload, _ := json.Marshal(evt)
-	for _, ch := range subs {
+	w.WriteString("data: ")
+	w.Write(frame.payload)
+	w.WriteString("\n\n")
+}
+
+type wsFrame struct {
+	Type           string                `json:"type"`
+	ConversationID models.ConversationID `json:"conversation_id,omitempty"`
+	EventID        int64                 `json:"event_id,omitempty"`
+}
+
+// StreamWS upgrades to a WebSocket carrying the same events as Stream, plus
+// client->server subscribe/unsubscribe/typing frames and presence heartbeats.
+func (h *ChatHandler) StreamWS(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	userID, ok := resolveStreamUser(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	c.Locals("chatUserID", userID)
+	return websocket.New(handleChatWS)(c)
+}
+
+func handleChatWS(conn *websocket.Conn) {
+	userID, _ := conn.Locals("chatUserID").(models.UserID)
+	wc := &wsConn{conn: conn, subscriptions: make(map[models.ConversationID]bool)}
+	chatHub.addWS(userID, wc)
+	broadcastPresence(userID, presenceOnline)
+
+	heartbeat := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	go presenceWatchdog(userID, heartbeat, stop)
+
+	defer func() {
+		close(stop)
+		chatHub.removeWS(userID, wc)
+		broadcastPresence(userID, presenceOffline)
+		conn.Close()
+	}()
+
+	for {
+		var frame wsFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			break
+		}
+		switch frame.Type {
+		case "subscribe":
+			wc.mu.Lock()
+			wc.subscriptions[frame.ConversationID] = true
+			wc.mu.Unlock()
+		case "unsubscribe":
+			wc.mu.Lock()
+			delete(wc.subscriptions, frame.ConversationID)
+			wc.mu.Unlock()
+		case "typing":
+			broadcastTyping(userID, frame.ConversationID)
+		case "event_ack":
+			if err := eventbus.MarkDelivered(userID, frame.EventID); err != nil {
+				log.Printf("chat: failed to mark event %d delivered: %v", frame.EventID, err)
+			}
+		case "heartbeat":
+			select {
+			case heartbeat <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// presenceWatchdog flips a user to "away" if no heartbeat frame arrives
+// within the window, and back to "online" as soon as one does. The timer is
+// reset on every heartbeat rather than ticking on a fixed period, so an
+// actively-heartbeating client never gets flipped to "away" mid-window.
+func presenceWatchdog(userID models.UserID, heartbeat <-chan struct{}, stop <-chan struct{}) {
+	timer := time.NewTimer(presenceHeartbeatWindow)
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-heartbeat:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(presenceHeartbeatWindow)
+			if chatHub.presenceOf(userID) == presenceAway {
+				chatHub.setPresence(userID, presenceOnline)
+				broadcastPresence(userID, presenceOnline)
+			}
+		case <-timer.C:
+			timer.Reset(presenceHeartbeatWindow)
+			if chatHub.presenceOf(userID) == presenceOnline {
+				chatHub.setPresence(userID, presenceAway)
+				broadcastPresence(userID, presenceAway)
+			}
+		}
+	}
+}
+
+// publishToUser durably logs an event via the eventbus and attempts live
+// delivery to every transport the user currently has open. Routing through
+// eventbus.Publish (rather than dispatching to chatHub directly) is what
+// turns the chat from fire-and-forget into at-least-once delivery: the event
+// survives a dropped/absent connection and gets replayed on reconnect.
+func publishToUser(userID models.UserID, evt sseEvent) {
+	if _, err := eventbus.Publish(userID, evt.Type, evt); err != nil {
+		log.Printf("chat: failed to publish %s event for user %d: %v", evt.Type, userID, err)
+	}
+}
+
+// deliverLive is the eventbus.DeliverFunc registered by this package: it
+// fans the event out to chatHub's live transports and reports whether any
+// of them plausibly received it, so the eventbus knows whether to mark the
+// event delivered or keep it around for retry.
+func deliverLive(userID models.UserID, eventID int64, eventType string, data interface{}) bool {
+	sseSubs, _ := chatHub.sse.get(userID)
+	wsConns, _ := chatHub.ws.get(userID)
+	if len(sseSubs) == 0 && len(wsConns) == 0 {
+		return false
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+	delivered := false
+	for _, ch := range sseSubs {
 		select {
-		case ch <- payload:
+		case ch <- streamFrame{id: eventID, payload: payload}:
+			delivered = true
 		default:
 		}
 	}
+	conversationID, scoped := conversationIDFromPayload(payload)
+	scoped = scoped && conversationScopedEventTypes[eventType]
+	for _, wc := range wsConns {
+		if scoped && !wc.subscribed(conversationID) {
+			continue
+		}
+		if err := wc.writeRaw(payload); err == nil {
+			delivered = true
+		}
+	}
+	return delivered
+}
+
+// conversationScopedEventTypes are the event types a WS client only wants
+// while actively subscribed to that conversation. unread/read/presence are
+// deliberately excluded: they drive the conversation-list UI (unread
+// badges, "seen" ticks, online dots) for conversations the client is
+// precisely *not* looking at, so they must reach every connection
+// regardless of subscription state.
+var conversationScopedEventTypes = map[string]bool{
+	"message":         true,
+	"typing":          true,
+	"message_edited":  true,
+	"message_deleted": true,
+}
+
+// conversationIDFromPayload reads the optional data.conversation_id field out
+// of a marshaled sseEvent. It works on the already-marshaled JSON (rather
+// than type-asserting the Go value) so it behaves the same whether data
+// arrived as a freshly built sseEvent or as a re-decoded retry payload.
+func conversationIDFromPayload(payload []byte) (models.ConversationID, bool) {
+	var envelope struct {
+		Data struct {
+			ConversationID *models.ConversationID `json:"conversation_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil || envelope.Data.ConversationID == nil {
+		return 0, false
+	}
+	return *envelope.Data.ConversationID, true
+}
+
+// broadcastPresence notifies every peer the user shares a conversation with.
+func broadcastPresence(userID models.UserID, state string) {
+	peers := getUserPeers(userID)
+	evt := sseEvent{Type: "presence", Data: fiber.Map{"user_id": userID, "state": state}}
+	for _, pid := range peers {
+		publishToUser(pid, evt)
+	}
+}
+
+// broadcastTyping notifies the other participants of a conversation that
+// userID is typing. Used by both the WS "typing" frame and the legacy
+// /typing HTTP route.
+func broadcastTyping(userID models.UserID, conversationID models.ConversationID) {
+	participants := getConversationParticipants(conversationID)
+	evt := sseEvent{Type: "typing", Data: fiber.Map{"conversation_id": conversationID, "user_id": userID}}
+	for _, pid := range participants {
+		if pid == userID {
+			continue
+		}
+		publishToUser(pid, evt)
+	}
+}
+
+// getUserPeers returns the distinct set of users who share a conversation
+// with userID, used to scope presence broadcasts.
+func getUserPeers(userID models.UserID) []models.UserID {
+	rows, err := database.DB.Query(`SELECT DISTINCT CASE WHEN buyer_id = ? THEN seller_id ELSE buyer_id END
+		FROM conversations WHERE buyer_id = ? OR seller_id = ?`, userID, userID, userID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var peers []models.UserID
+	for rows.Next() {
+		var pid models.UserID
+		if err := rows.Scan(&pid); err == nil {
+			peers = append(peers, pid)
+		}
+	}
+	return peers
 }
 
 // Helper to publish notification event
-func publishNotification(userID int, message string) {
+func publishNotification(userID models.UserID, message string) {
 	publishToUser(userID, sseEvent{Type: "notification", Data: fiber.Map{"message": message}})
 }
 
 // EnsureConversation creates or returns an existing conversation
 func (h *ChatHandler) EnsureConversation(c *fiber.Ctx) error {
-	var p struct{ ProductID, BuyerID, SellerID int }
+	var p struct {
+		ProductID models.ProductID
+		BuyerID   models.UserID
+		SellerID  models.UserID
+	}
 	if err := c.BodyParser(&p); err != nil {
 		return fiber.ErrBadRequest
 	}
@@ -120,63 +542,291 @@ func (h *ChatHandler) EnsureConversation(c *fiber.Ctx) error {
 	return c.JSON(models.APIResponse{Success: true, Data: fiber.Map{"conversation_id": id}})
 }
 
-// SendMessage saves message and notifies participants
+// SendMessage saves message and notifies participants. Content may be
+// accompanied by attachment_ids from a prior UploadAttachment call; a kind
+// other than "text" is typically paired with attachments or an inline offer.
 func (h *ChatHandler) SendMessage(c *fiber.Ctx) error {
 	userID, ok := middleware.GetUserIDFromContext(c)
 	if !ok {
 		return fiber.ErrUnauthorized
 	}
 	var p struct {
-		ConversationID int
+		ConversationID models.ConversationID
 		Content        string
+		Kind           messageKind
+		AttachmentIDs  []int64 `json:"attachment_ids"`
 	}
 	if err := c.BodyParser(&p); err != nil {
 		return fiber.ErrBadRequest
 	}
-	if p.ConversationID == 0 || p.Content == "" {
+	if p.Kind == "" {
+		p.Kind = messageKindText
+	}
+	if !p.Kind.valid() {
+		return fiber.ErrBadRequest
+	}
+	if !p.ConversationID.Valid() || (p.Content == "" && len(p.AttachmentIDs) == 0) {
 		return fiber.ErrBadRequest
 	}
-	msgID, createdAt, err := saveMessage(p.ConversationID, userID, p.Content)
+	if len(p.AttachmentIDs) > 0 {
+		if err := validateAttachmentOwnership(userID, p.AttachmentIDs); err != nil {
+			return fiber.ErrBadRequest
+		}
+	}
+	msgID, createdAt, err := saveMessage(p.ConversationID, userID, p.Content, p.Kind)
 	if err != nil {
 		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to send message"})
 	}
+	var attachments []chatAttachment
+	if len(p.AttachmentIDs) > 0 {
+		if err := bindAttachments(msgID, p.AttachmentIDs); err != nil {
+			return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to attach files"})
+		}
+		attachments, _ = attachmentsForMessage(msgID)
+	}
 	participants := getConversationParticipants(p.ConversationID)
 	evt := sseEvent{Type: "message", Data: fiber.Map{
 		"id":              msgID,
 		"conversation_id": p.ConversationID,
 		"sender_id":       userID,
 		"content":         p.Content,
+		"kind":            p.Kind,
+		"attachments":     attachments,
 		"created_at":      createdAt,
 	}}
 	for _, pid := range participants {
 		publishToUser(pid, evt)
+		if pid == userID {
+			continue
+		}
+		if count, err := unreadCountFor(p.ConversationID, pid); err == nil {
+			publishToUser(pid, sseEvent{Type: "unread", Data: fiber.Map{
+				"conversation_id": p.ConversationID,
+				"unread_count":    count,
+			}})
+		}
 	}
 	return c.JSON(models.APIResponse{Success: true})
 }
 
-// Typing event notify
+// AckMessages marks every message in a conversation up to upToMessageID as
+// read (on behalf of the caller) and publishes a "read" event so the
+// sender's bubbles can flip to "seen" live.
+func (h *ChatHandler) AckMessages(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	convID, err := parseConversationID(c.Params("id"))
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	var p struct {
+		UpToMessageID models.MessageID `json:"up_to_message_id"`
+	}
+	if err := c.BodyParser(&p); err != nil || !p.UpToMessageID.Valid() {
+		return fiber.ErrBadRequest
+	}
+	buyerID, sellerID, err := conversationParties(convID)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	if userID != buyerID && userID != sellerID {
+		return fiber.ErrForbidden
+	}
+
+	readAt := time.Now()
+	res, err := database.DB.Exec(`UPDATE messages SET read_at = ? WHERE conversation_id = ? AND id <= ? AND sender_id != ? AND read_at IS NULL`,
+		readAt, convID, p.UpToMessageID, userID)
+	if err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to ack messages"})
+	}
+	updated, _ := res.RowsAffected()
+
+	counterpart := sellerID
+	if userID == sellerID {
+		counterpart = buyerID
+	}
+	publishToUser(counterpart, sseEvent{Type: "read", Data: fiber.Map{
+		"conversation_id": convID,
+		"reader_id":       userID,
+		"up_to_id":        p.UpToMessageID,
+		"read_at":         readAt,
+	}})
+	return c.JSON(models.APIResponse{Success: true, Data: fiber.Map{"updated": updated}})
+}
+
+// GetUnreadCount returns how many messages in the conversation are unread by
+// the caller.
+func (h *ChatHandler) GetUnreadCount(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	convID, err := parseConversationID(c.Params("id"))
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	buyerID, sellerID, err := conversationParties(convID)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	if userID != buyerID && userID != sellerID {
+		return fiber.ErrForbidden
+	}
+	count, err := unreadCountFor(convID, userID)
+	if err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to get unread count"})
+	}
+	return c.JSON(models.APIResponse{Success: true, Data: fiber.Map{"unread_count": count}})
+}
+
+// Typing event notify. Kept for non-WS clients; WS clients should send a
+// "typing" frame over StreamWS instead, which skips the HTTP round-trip.
 func (h *ChatHandler) Typing(c *fiber.Ctx) error {
 	userID, ok := middleware.GetUserIDFromContext(c)
 	if !ok {
 		return fiber.ErrUnauthorized
 	}
-	var p struct{ ConversationID int }
+	var p struct{ ConversationID models.ConversationID }
 	if err := c.BodyParser(&p); err != nil {
 		return fiber.ErrBadRequest
 	}
-	participants := getConversationParticipants(p.ConversationID)
-	evt := sseEvent{Type: "typing", Data: fiber.Map{"conversation_id": p.ConversationID, "user_id": userID}}
-	for _, pid := range participants {
-		if pid == userID {
-			continue
-		}
+	broadcastTyping(userID, p.ConversationID)
+	return c.JSON(models.APIResponse{Success: true})
+}
+
+// UploadAttachment records an unbound attachment and hands back an object
+// key (see signedObjectKey; it carries no signature) for the caller to PUT
+// the bytes to. The attachment stays
+// unbound until a subsequent SendMessage claims it via attachment_ids.
+func (h *ChatHandler) UploadAttachment(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	var p struct {
+		Mime   string `json:"mime"`
+		Size   int64  `json:"size"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	}
+	if err := c.BodyParser(&p); err != nil || p.Mime == "" {
+		return fiber.ErrBadRequest
+	}
+	key := signedObjectKey(userID, p.Mime)
+	res, err := database.DB.Exec(
+		"INSERT INTO attachments (uploader_id, url, mime, size, width, height) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, key, p.Mime, p.Size, p.Width, p.Height,
+	)
+	if err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to create upload"})
+	}
+	id, _ := res.LastInsertId()
+	return c.JSON(models.APIResponse{Success: true, Data: fiber.Map{
+		"attachment_id": id,
+		"url":           key,
+	}})
+}
+
+// EditMessage lets the sender revise a message's content within
+// messageEditWindow of sending it, and notifies participants live.
+func (h *ChatHandler) EditMessage(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	msgID, err := parseMessageID(c.Params("id"))
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	var p struct{ Content string }
+	if err := c.BodyParser(&p); err != nil || p.Content == "" {
+		return fiber.ErrBadRequest
+	}
+
+	var conversationID models.ConversationID
+	var senderID models.UserID
+	var createdAt time.Time
+	var deletedAt sql.NullTime
+	err = database.DB.QueryRow("SELECT conversation_id, sender_id, created_at, deleted_at FROM messages WHERE id = ?", msgID).
+		Scan(&conversationID, &senderID, &createdAt, &deletedAt)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	if senderID != userID {
+		return fiber.ErrForbidden
+	}
+	if deletedAt.Valid {
+		return fiber.ErrGone
+	}
+	if time.Since(createdAt) > messageEditWindow {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(models.APIResponse{Success: false, Error: "Edit window has expired"})
+	}
+
+	editedAt := time.Now()
+	if _, err := database.DB.Exec("UPDATE messages SET content = ?, edited_at = ? WHERE id = ?", p.Content, editedAt, msgID); err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to edit message"})
+	}
+
+	evt := sseEvent{Type: "message_edited", Data: fiber.Map{
+		"id":              msgID,
+		"conversation_id": conversationID,
+		"content":         p.Content,
+		"edited_at":       editedAt,
+	}}
+	for _, pid := range getConversationParticipants(conversationID) {
 		publishToUser(pid, evt)
 	}
 	return c.JSON(models.APIResponse{Success: true})
 }
 
-func ensureConversation(productID, buyerID, sellerID int) (int, error) {
-	var id int
+// DeleteMessage soft-deletes a message: the row stays, but its content is
+// replaced with tombstoneContent and deleted_at is set, so GetMessages can
+// redact it for every participant.
+func (h *ChatHandler) DeleteMessage(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	msgID, err := parseMessageID(c.Params("id"))
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var conversationID models.ConversationID
+	var senderID models.UserID
+	var deletedAt sql.NullTime
+	err = database.DB.QueryRow("SELECT conversation_id, sender_id, deleted_at FROM messages WHERE id = ?", msgID).
+		Scan(&conversationID, &senderID, &deletedAt)
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+	if senderID != userID {
+		return fiber.ErrForbidden
+	}
+	if deletedAt.Valid {
+		return c.JSON(models.APIResponse{Success: true})
+	}
+
+	now := time.Now()
+	if _, err := database.DB.Exec("UPDATE messages SET content = ?, deleted_at = ? WHERE id = ?", tombstoneContent, now, msgID); err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to delete message"})
+	}
+
+	evt := sseEvent{Type: "message_deleted", Data: fiber.Map{
+		"id":              msgID,
+		"conversation_id": conversationID,
+		"deleted_at":      now,
+	}}
+	for _, pid := range getConversationParticipants(conversationID) {
+		publishToUser(pid, evt)
+	}
+	return c.JSON(models.APIResponse{Success: true})
+}
+
+func ensureConversation(productID models.ProductID, buyerID, sellerID models.UserID) (models.ConversationID, error) {
+	var id models.ConversationID
 	err := database.DB.QueryRow("SELECT id FROM conversations WHERE product_id = ? AND buyer_id = ? AND seller_id = ?", productID, buyerID, sellerID).Scan(&id)
 	if err == nil {
 		return id, nil
@@ -186,26 +836,140 @@ func ensureConversation(productID, buyerID, sellerID int) (int, error) {
 		return 0, err
 	}
 	lastID, _ := res.LastInsertId()
-	return int(lastID), nil
+	return models.ConversationID(lastID), nil
 }
 
-func saveMessage(conversationID, senderID int, content string) (int, time.Time, error) {
-	res, err := database.DB.Exec("INSERT INTO messages (conversation_id, sender_id, content) VALUES (?, ?, ?)", conversationID, senderID, content)
+func saveMessage(conversationID models.ConversationID, senderID models.UserID, content string, kind messageKind) (models.MessageID, time.Time, error) {
+	res, err := database.DB.Exec("INSERT INTO messages (conversation_id, sender_id, content, kind) VALUES (?, ?, ?, ?)", conversationID, senderID, content, kind)
 	if err != nil {
 		return 0, time.Now(), err
 	}
 	id64, _ := res.LastInsertId()
 	var createdAt time.Time
 	_ = database.DB.QueryRow("SELECT created_at FROM messages WHERE id = ?", id64).Scan(&createdAt)
-	return int(id64), createdAt, nil
+	return models.MessageID(id64), createdAt, nil
+}
+
+// validateAttachmentOwnership checks that every attachment id belongs to
+// userID and isn't already bound to another message, so one user can't
+// claim another's upload or re-attach a file that's already posted.
+func validateAttachmentOwnership(userID models.UserID, attachmentIDs []int64) error {
+	for _, id := range attachmentIDs {
+		var uploaderID models.UserID
+		var messageID sql.NullInt64
+		err := database.DB.QueryRow("SELECT uploader_id, message_id FROM attachments WHERE id = ?", id).Scan(&uploaderID, &messageID)
+		if err != nil {
+			return err
+		}
+		if uploaderID != userID {
+			return fmt.Errorf("attachment %d does not belong to sender", id)
+		}
+		if messageID.Valid {
+			return fmt.Errorf("attachment %d is already bound to a message", id)
+		}
+	}
+	return nil
+}
+
+// bindAttachments claims a batch of previously-uploaded attachments for msgID.
+func bindAttachments(msgID models.MessageID, attachmentIDs []int64) error {
+	for _, id := range attachmentIDs {
+		if _, err := database.DB.Exec("UPDATE attachments SET message_id = ? WHERE id = ?", msgID, id); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func getConversationParticipants(conversationID int) []int {
-	var buyerID, sellerID int
-	if err := database.DB.QueryRow("SELECT buyer_id, seller_id FROM conversations WHERE id = ?", conversationID).Scan(&buyerID, &sellerID); err != nil {
-		return []int{}
+// attachmentsForMessage loads every attachment bound to a message, for
+// inlining into GetMessages/SendMessage responses.
+func attachmentsForMessage(msgID models.MessageID) ([]chatAttachment, error) {
+	rows, err := database.DB.Query("SELECT id, url, mime, size, width, height, thumb_url FROM attachments WHERE message_id = ?", msgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []chatAttachment
+	for rows.Next() {
+		var a chatAttachment
+		var width, height sql.NullInt64
+		var thumbURL sql.NullString
+		if err := rows.Scan(&a.ID, &a.URL, &a.Mime, &a.Size, &width, &height, &thumbURL); err != nil {
+			continue
+		}
+		a.Width = int(width.Int64)
+		a.Height = int(height.Int64)
+		a.ThumbURL = thumbURL.String
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+// signedObjectKey mints an object storage key for an upload from the
+// uploader's id, the current wall-clock time in nanoseconds and an extension
+// taken from the mime type. The key is not signed, and anyone who knows the
+// uploader's id and the upload time can reconstruct it.
+func signedObjectKey(userID models.UserID, mime string) string {
+	return fmt.Sprintf("chat-attachments/%d/%d%s", userID, time.Now().UnixNano(), extensionForMime(mime))
+}
+
+func extensionForMime(mime string) string {
+	if idx := strings.LastIndex(mime, "/"); idx != -1 && idx+1 < len(mime) {
+		return "." + mime[idx+1:]
 	}
-	return []int{buyerID, sellerID}
+	return ""
+}
+
+func getConversationParticipants(conversationID models.ConversationID) []models.UserID {
+	buyerID, sellerID, err := conversationParties(conversationID)
+	if err != nil {
+		return []models.UserID{}
+	}
+	return []models.UserID{buyerID, sellerID}
+}
+
+// conversationParties looks up the buyer/seller pair for a conversation, the
+// shared building block for every participation check in this handler.
+func conversationParties(conversationID models.ConversationID) (buyerID, sellerID models.UserID, err error) {
+	err = database.DB.QueryRow("SELECT buyer_id, seller_id FROM conversations WHERE id = ?", conversationID).Scan(&buyerID, &sellerID)
+	return buyerID, sellerID, err
+}
+
+// unreadCountFor returns how many messages in a conversation are unread by
+// userID (i.e. sent by the other participant and not yet acked).
+func unreadCountFor(conversationID models.ConversationID, userID models.UserID) (int, error) {
+	var count int
+	err := database.DB.QueryRow(
+		"SELECT COUNT(*) FROM messages WHERE conversation_id = ? AND read_at IS NULL AND sender_id != ?",
+		conversationID, userID,
+	).Scan(&count)
+	return count, err
+}
+
+// parseConversationID parses a route param into a ConversationID.
+func parseConversationID(raw string) (models.ConversationID, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return models.ConversationID(id), nil
+}
+
+// parseMessageID parses a route param into a MessageID.
+func parseMessageID(raw string) (models.MessageID, error) {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return models.MessageID(id), nil
+}
+
+// conversationWithUnread augments a conversation with the caller's unread
+// count, without changing the shared ChatConversation model.
+type conversationWithUnread struct {
+	models.ChatConversation
+	UnreadCount int `json:"unread_count"`
 }
 
 // Existing endpoints for listing conversations/messages
@@ -214,47 +978,210 @@ func (h *ChatHandler) GetConversations(c *fiber.Ctx) error {
 	if !ok {
 		return fiber.ErrUnauthorized
 	}
-	rows, err := database.DB.Query("SELECT id, product_id, buyer_id, seller_id, created_at, updated_at FROM conversations WHERE buyer_id = ? OR seller_id = ? ORDER BY updated_at DESC", userID, userID)
+	rows, err := database.DB.Query(`SELECT c.id, c.product_id, c.buyer_id, c.seller_id, c.created_at, c.updated_at,
+		(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id AND m.read_at IS NULL AND m.sender_id != ?) AS unread_count
+		FROM conversations c WHERE c.buyer_id = ? OR c.seller_id = ? ORDER BY c.updated_at DESC`, userID, userID, userID)
 	if err != nil {
 		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to get conversations"})
 	}
 	defer rows.Close()
-	var list []models.ChatConversation
+	var list []conversationWithUnread
 	for rows.Next() {
-		var conv models.ChatConversation
-		if err := rows.Scan(&conv.ID, &conv.ProductID, &conv.BuyerID, &conv.SellerID, &conv.CreatedAt, &conv.UpdatedAt); err == nil {
+		var conv conversationWithUnread
+		if err := rows.Scan(&conv.ID, &conv.ProductID, &conv.BuyerID, &conv.SellerID, &conv.CreatedAt, &conv.UpdatedAt, &conv.UnreadCount); err == nil {
 			list = append(list, conv)
 		}
 	}
 	return c.JSON(models.APIResponse{Success: true, Data: list})
 }
 
+// messageWithAttachments augments a message with its kind, edit/delete
+// state and bound attachments, without changing the shared ChatMessage
+// model. Tombstoned rows have Content redacted to tombstoneContent.
+type messageWithAttachments struct {
+	models.ChatMessage
+	Kind        messageKind      `json:"kind"`
+	EditedAt    *time.Time       `json:"edited_at,omitempty"`
+	DeletedAt   *time.Time       `json:"deleted_at,omitempty"`
+	Attachments []chatAttachment `json:"attachments,omitempty"`
+}
+
 func (h *ChatHandler) GetMessages(c *fiber.Ctx) error {
 	userID, ok := middleware.GetUserIDFromContext(c)
 	if !ok {
 		return fiber.ErrUnauthorized
 	}
-	convID, _ := strconv.Atoi(c.Params("id"))
-	var buyerID, sellerID int
-	if err := database.DB.QueryRow("SELECT buyer_id, seller_id FROM conversations WHERE id = ?", convID).Scan(&buyerID, &sellerID); err != nil {
+	convID, err := parseConversationID(c.Params("id"))
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+	buyerID, sellerID, err := conversationParties(convID)
+	if err != nil {
 		return fiber.ErrNotFound
 	}
 	if userID != buyerID && userID != sellerID {
 		return fiber.ErrForbidden
 	}
-	rows, err := database.DB.Query("SELECT id, conversation_id, sender_id, content, created_at, read_at FROM messages WHERE conversation_id = ? ORDER BY created_at ASC", convID)
+	rows, err := database.DB.Query(
+		"SELECT id, conversation_id, sender_id, content, kind, created_at, read_at, edited_at, deleted_at FROM messages WHERE conversation_id = ? ORDER BY created_at ASC",
+		convID,
+	)
 	if err != nil {
 		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to get messages"})
 	}
 	defer rows.Close()
-	var list []models.ChatMessage
+	var list []messageWithAttachments
 	for rows.Next() {
-		var m models.ChatMessage
-		var readAtNullable *time.Time
-		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt, &readAtNullable); err == nil {
-			m.ReadAt = readAtNullable
-			list = append(list, m)
+		var m messageWithAttachments
+		var readAtNullable, editedAtNullable, deletedAtNullable *time.Time
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.Kind, &m.CreatedAt, &readAtNullable, &editedAtNullable, &deletedAtNullable); err != nil {
+			continue
 		}
+		m.ReadAt = readAtNullable
+		m.EditedAt = editedAtNullable
+		m.DeletedAt = deletedAtNullable
+		if m.DeletedAt != nil {
+			m.Content = tombstoneContent
+		} else if attachments, err := attachmentsForMessage(m.ID); err == nil {
+			m.Attachments = attachments
+		}
+		list = append(list, m)
 	}
 	return c.JSON(models.APIResponse{Success: true, Data: list})
 }
+
+type searchHit struct {
+	MessageID      models.MessageID      `json:"message_id"`
+	ConversationID models.ConversationID `json:"conversation_id"`
+	SenderID       models.UserID         `json:"sender_id"`
+	CreatedAt      time.Time             `json:"created_at"`
+	Snippet        string                `json:"snippet"`
+}
+
+// SearchMessages runs a full-text search over the caller's own conversations
+// using the messages_fts FTS5 index, ranked by BM25 with keyset pagination
+// over (rank, rowid). The query string supports FTS5 phrase ("...") and
+// prefix (token*) syntax natively via MATCH.
+func (h *ChatHandler) SearchMessages(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	query := strings.TrimSpace(c.Query("q", ""))
+	if query == "" {
+		return fiber.ErrBadRequest
+	}
+	limit, err := strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	sqlStr := `SELECT m.id, m.conversation_id, m.sender_id, m.created_at,
+			snippet(messages_fts, 0, '<mark>', '</mark>', '…', 10) AS snippet,
+			messages_fts.rank AS rank
+		FROM messages_fts
+		JOIN messages m ON m.id = messages_fts.rowid
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE messages_fts MATCH ?
+			AND (c.buyer_id = ? OR c.seller_id = ?)`
+	args := []interface{}{query, userID, userID}
+
+	if raw := c.Query("conversation_id", ""); raw != "" {
+		convID, err := parseConversationID(raw)
+		if err != nil {
+			return fiber.ErrBadRequest
+		}
+		sqlStr += " AND m.conversation_id = ?"
+		args = append(args, convID)
+	}
+
+	if rank, rowID, ok := decodeSearchCursor(c.Query("cursor", "")); ok {
+		sqlStr += " AND (messages_fts.rank, m.id) > (?, ?)"
+		args = append(args, rank, rowID)
+	}
+
+	sqlStr += " ORDER BY messages_fts.rank, m.id LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := database.DB.Query(sqlStr, args...)
+	if err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Search failed"})
+	}
+	defer rows.Close()
+
+	var hits []searchHit
+	var ranks []float64
+	for rows.Next() {
+		var hit searchHit
+		var rank float64
+		if err := rows.Scan(&hit.MessageID, &hit.ConversationID, &hit.SenderID, &hit.CreatedAt, &hit.Snippet, &rank); err == nil {
+			hits = append(hits, hit)
+			ranks = append(ranks, rank)
+		}
+	}
+
+	var nextCursor string
+	if len(hits) > limit {
+		hits = hits[:limit]
+		ranks = ranks[:limit]
+		nextCursor = encodeSearchCursor(ranks[limit-1], int64(hits[limit-1].MessageID))
+	}
+
+	return c.JSON(models.APIResponse{Success: true, Data: fiber.Map{
+		"hits":        hits,
+		"next_cursor": nextCursor,
+	}})
+}
+
+func encodeSearchCursor(rank float64, rowID int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", strconv.FormatFloat(rank, 'g', -1, 64), rowID)))
+}
+
+func decodeSearchCursor(cursor string) (rank float64, rowID int64, ok bool) {
+	if cursor == "" {
+		return 0, 0, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	rank, rankErr := strconv.ParseFloat(parts[0], 64)
+	rowID, rowErr := strconv.ParseInt(parts[1], 10, 64)
+	if rankErr != nil || rowErr != nil {
+		return 0, 0, false
+	}
+	return rank, rowID, true
+}
+
+// RebuildSearchIndex forces a full rebuild of the messages_fts index.
+// Intended to be wired behind an admin-only route.
+func (h *ChatHandler) RebuildSearchIndex(c *fiber.Ctx) error {
+	if err := database.RebuildFTS(); err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to rebuild search index"})
+	}
+	return c.JSON(models.APIResponse{Success: true})
+}
+
+// AckEvent marks an eventbus event as delivered. WS clients can ack inline
+// via an "event_ack" frame; this endpoint covers SSE clients, which have no
+// client->server channel of their own.
+func (h *ChatHandler) AckEvent(c *fiber.Ctx) error {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok {
+		return fiber.ErrUnauthorized
+	}
+	var p struct {
+		EventID int64 `json:"event_id"`
+	}
+	if err := c.BodyParser(&p); err != nil || p.EventID == 0 {
+		return fiber.ErrBadRequest
+	}
+	if err := eventbus.MarkDelivered(userID, p.EventID); err != nil {
+		return c.Status(500).JSON(models.APIResponse{Success: false, Error: "Failed to ack event"})
+	}
+	return c.JSON(models.APIResponse{Success: true})
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import "testing"
+
+func TestSearchCursorRoundTrip(t *testing.T) {
+	cases := []struct {
+		rank  float64
+		rowID int64
+	}{
+		{rank: 0, rowID: 1},
+		{rank: -1.5, rowID: 42},
+		{rank: -0.123456789012345, rowID: 9007199254740993},
+	}
+	for _, tc := range cases {
+		cursor := encodeSearchCursor(tc.rank, tc.rowID)
+		gotRank, gotRowID, ok := decodeSearchCursor(cursor)
+		if !ok {
+			t.Fatalf("decodeSearchCursor(%q) returned ok=false", cursor)
+		}
+		if gotRank != tc.rank {
+			t.Errorf("rank round-trip: got %v, want %v", gotRank, tc.rank)
+		}
+		if gotRowID != tc.rowID {
+			t.Errorf("rowID round-trip: got %v, want %v", gotRowID, tc.rowID)
+		}
+	}
+}
+
+func TestDecodeSearchCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"", "not-base64!!", "====", "YmFk"} {
+		if _, _, ok := decodeSearchCursor(cursor); ok {
+			t.Errorf("decodeSearchCursor(%q) = ok, want failure", cursor)
+		}
+	}
+}
+
+func TestMessageKindValid(t *testing.T) {
+	valid := []messageKind{messageKindText, messageKindImage, messageKindFile, messageKindOffer, messageKindSystem}
+	for _, k := range valid {
+		if !k.valid() {
+			t.Errorf("messageKind(%q).valid() = false, want true", k)
+		}
+	}
+	for _, k := range []messageKind{"", "bogus", "TEXT"} {
+		if k.valid() {
+			t.Errorf("messageKind(%q).valid() = true, want false", k)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/xashathebest/clovia/models"
+)
+
+// jwtSecret signs and verifies the bearer tokens AuthMiddleware checks.
+var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+
+// AuthMiddleware verifies the Authorization: Bearer <token> header and
+// stores the authenticated user's id in Locals("userID") as a
+// models.UserID, the type GetUserIDFromContext and every chat handler
+// expect. It was storing a plain int before models.UserID existed; that
+// changed when the chat package switched to typed ids, so this must keep
+// writing whatever GetUserIDFromContext reads.
+func AuthMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		header := c.Get("Authorization")
+		tokenString := strings.TrimPrefix(header, "Bearer ")
+		if tokenString == "" || tokenString == header {
+			return fiber.ErrUnauthorized
+		}
+
+		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+			return jwtSecret, nil
+		})
+		if err != nil || !token.Valid {
+			return fiber.ErrUnauthorized
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return fiber.ErrUnauthorized
+		}
+		userID, err := userIDFromClaims(claims)
+		if err != nil {
+			return fiber.ErrUnauthorized
+		}
+
+		c.Locals("userID", userID)
+		return c.Next()
+	}
+}
+
+// userIDFromClaims reads the user_id claim, accepting either a JSON number
+// (the common case after json.Unmarshal) or a numeric string.
+func userIDFromClaims(claims jwt.MapClaims) (models.UserID, error) {
+	switch v := claims["user_id"].(type) {
+	case float64:
+		return models.UserID(int64(v)), nil
+	case string:
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return models.UserID(id), nil
+	default:
+		return 0, strconv.ErrSyntax
+	}
+}
@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/xashathebest/clovia/models"
+)
+
+// GetUserIDFromContext returns the authenticated caller's ID, as set by
+// AuthMiddleware, typed as models.UserID so it can't be passed where a
+// ConversationID or ProductID is expected without a compile error.
+func GetUserIDFromContext(c *fiber.Ctx) (models.UserID, bool) {
+	id, ok := c.Locals("userID").(models.UserID)
+	return id, ok
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// UserID, ConversationID, MessageID and ProductID give the chat subsystem
+// distinct types for what used to be raw ints passed around as userID,
+// ConversationID and ProductID. A BodyParser struct like
+// `struct{ ProductID, BuyerID, SellerID int }` lets a caller swap two
+// fields of the same type without the compiler noticing; typing each as
+// its own int64 closes that hole.
+type (
+	UserID         int64
+	ConversationID int64
+	MessageID      int64
+	ProductID      int64
+)
+
+// Valid reports whether the id looks like a real row id rather than a zero
+// value left over from an unset field.
+func (id UserID) Valid() bool         { return id > 0 }
+func (id ConversationID) Valid() bool { return id > 0 }
+func (id MessageID) Valid() bool      { return id > 0 }
+func (id ProductID) Valid() bool      { return id > 0 }
+
+func (id UserID) MarshalJSON() ([]byte, error)         { return json.Marshal(int64(id)) }
+func (id ConversationID) MarshalJSON() ([]byte, error) { return json.Marshal(int64(id)) }
+func (id MessageID) MarshalJSON() ([]byte, error)      { return json.Marshal(int64(id)) }
+func (id ProductID) MarshalJSON() ([]byte, error)      { return json.Marshal(int64(id)) }
+
+func (id *UserID) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalIDJSON(b, "UserID")
+	if err != nil {
+		return err
+	}
+	*id = UserID(v)
+	return nil
+}
+
+func (id *ConversationID) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalIDJSON(b, "ConversationID")
+	if err != nil {
+		return err
+	}
+	*id = ConversationID(v)
+	return nil
+}
+
+func (id *MessageID) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalIDJSON(b, "MessageID")
+	if err != nil {
+		return err
+	}
+	*id = MessageID(v)
+	return nil
+}
+
+func (id *ProductID) UnmarshalJSON(b []byte) error {
+	v, err := unmarshalIDJSON(b, "ProductID")
+	if err != nil {
+		return err
+	}
+	*id = ProductID(v)
+	return nil
+}
+
+func unmarshalIDJSON(b []byte, typeName string) (int64, error) {
+	var v int64
+	if err := json.Unmarshal(b, &v); err != nil {
+		return 0, fmt.Errorf("models: invalid %s: %w", typeName, err)
+	}
+	return v, nil
+}
+
+func (id UserID) Value() (driver.Value, error)         { return int64(id), nil }
+func (id ConversationID) Value() (driver.Value, error) { return int64(id), nil }
+func (id MessageID) Value() (driver.Value, error)      { return int64(id), nil }
+func (id ProductID) Value() (driver.Value, error)      { return int64(id), nil }
+
+func (id *UserID) Scan(src interface{}) error {
+	v, err := scanID(src)
+	if err != nil {
+		return err
+	}
+	*id = UserID(v)
+	return nil
+}
+
+func (id *ConversationID) Scan(src interface{}) error {
+	v, err := scanID(src)
+	if err != nil {
+		return err
+	}
+	*id = ConversationID(v)
+	return nil
+}
+
+func (id *MessageID) Scan(src interface{}) error {
+	v, err := scanID(src)
+	if err != nil {
+		return err
+	}
+	*id = MessageID(v)
+	return nil
+}
+
+func (id *ProductID) Scan(src interface{}) error {
+	v, err := scanID(src)
+	if err != nil {
+		return err
+	}
+	*id = ProductID(v)
+	return nil
+}
+
+// scanID normalizes whatever the driver hands back for an INTEGER column
+// into an int64, the common body for every typed id's Scan method.
+func scanID(src interface{}) (int64, error) {
+	switch v := src.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("models: cannot scan %T into a typed id", src)
+	}
+}
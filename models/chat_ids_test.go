@@ -0,0 +1,84 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUserIDJSONRoundTrip(t *testing.T) {
+	want := UserID(42)
+	b, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != "42" {
+		t.Errorf("Marshal(%v) = %s, want 42", want, b)
+	}
+	var got UserID
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got != want {
+		t.Errorf("round trip: got %v, want %v", got, want)
+	}
+}
+
+func TestUserIDUnmarshalInvalid(t *testing.T) {
+	var id UserID
+	if err := json.Unmarshal([]byte(`"not-a-number"`), &id); err == nil {
+		t.Error("Unmarshal of a non-numeric value should fail")
+	}
+}
+
+func TestUserIDValue(t *testing.T) {
+	v, err := UserID(7).Value()
+	if err != nil {
+		t.Fatalf("Value: %v", err)
+	}
+	if v != int64(7) {
+		t.Errorf("Value() = %v, want int64(7)", v)
+	}
+}
+
+func TestUserIDScan(t *testing.T) {
+	cases := []struct {
+		src     interface{}
+		want    UserID
+		wantErr bool
+	}{
+		{src: int64(5), want: 5},
+		{src: int32(5), want: 5},
+		{src: int(5), want: 5},
+		{src: nil, want: 0},
+		{src: "5", wantErr: true},
+	}
+	for _, tc := range cases {
+		var id UserID
+		err := id.Scan(tc.src)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("Scan(%v) = nil error, want error", tc.src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Scan(%v) returned error: %v", tc.src, err)
+			continue
+		}
+		if id != tc.want {
+			t.Errorf("Scan(%v) = %v, want %v", tc.src, id, tc.want)
+		}
+	}
+}
+
+func TestIDValid(t *testing.T) {
+	if UserID(0).Valid() {
+		t.Error("UserID(0).Valid() = true, want false")
+	}
+	if !UserID(1).Valid() {
+		t.Error("UserID(1).Valid() = false, want true")
+	}
+	if ConversationID(-1).Valid() {
+		t.Error("ConversationID(-1).Valid() = true, want false")
+	}
+}